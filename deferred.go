@@ -0,0 +1,177 @@
+package xslog
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+var _ slog.Handler = (*DeferredHandler)(nil)
+
+// DeferredHandler buffers records (and the WithAttrs/WithGroup chains that
+// produced them) in memory so they can be replayed into a real slog.Handler
+// once one becomes available. It exists for code that logs during init(),
+// or before an application has finished wiring up its real handler, where
+// those records would otherwise be lost.
+//
+// The buffer is bounded by maxRecords; once full, the oldest buffered
+// record is dropped to make room for the newest one. A non-positive
+// maxRecords means the buffer is unbounded.
+//
+// DeferredHandler is safe for concurrent use.
+type DeferredHandler struct {
+	core   *deferredCore
+	groups []group
+}
+
+type deferredCore struct {
+	mu         sync.Mutex
+	maxRecords int
+	records    []deferredRecord
+}
+
+type deferredRecord struct {
+	ctx    context.Context
+	groups []group
+	record slog.Record
+}
+
+// NewDeferredHandler creates a DeferredHandler that buffers up to maxRecords
+// records. A non-positive maxRecords disables the bound.
+func NewDeferredHandler(maxRecords int) *DeferredHandler {
+	return &DeferredHandler{
+		core: &deferredCore{
+			maxRecords: maxRecords,
+		},
+		groups: make([]group, 1),
+	}
+}
+
+// Enabled always reports true: DeferredHandler buffers every record it is
+// given and leaves level filtering to the handler it is eventually flushed
+// into.
+//
+//	Enabled implements slog.Handler interface.
+func (h *DeferredHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return true
+}
+
+// Handle buffers the record along with the current WithAttrs/WithGroup
+// chain, so it can be replayed faithfully by Flush.
+//
+//	Handle implements slog.Handler interface.
+func (h *DeferredHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.core.mu.Lock()
+	defer h.core.mu.Unlock()
+
+	h.core.records = append(h.core.records, deferredRecord{
+		ctx:    ctx,
+		groups: h.groups,
+		record: record.Clone(),
+	})
+
+	if h.core.maxRecords > 0 && len(h.core.records) > h.core.maxRecords {
+		dropped := len(h.core.records) - h.core.maxRecords
+		newRecords := make([]deferredRecord, h.core.maxRecords)
+		copy(newRecords, h.core.records[dropped:])
+		h.core.records = newRecords
+	}
+
+	return nil
+}
+
+// WithAttrs returns a new Handler whose attributes consist of
+// both the receiver's attributes and the arguments.
+// The Handler owns the slice: it may retain, modify or discard it.
+//
+//	WithAttrs implements slog.Handler interface
+func (h *DeferredHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	newh := h.clone(0, uint(len(attrs)))
+	lastGroupIDx := len(newh.groups) - 1
+
+	newh.groups[lastGroupIDx].attrs = append(newh.groups[lastGroupIDx].attrs, attrs...)
+
+	return newh
+}
+
+// WithGroup returns a new Handler with the given group appended to
+// the receiver's existing groups. If the name is empty, WithGroup returns
+// the receiver.
+//
+//	WithGroup implements slog.Handler interface.
+func (h *DeferredHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	newh := h.clone(1, 0)
+	newh.groups = append(newh.groups, group{
+		name: name,
+	})
+
+	return newh
+}
+
+func (h *DeferredHandler) clone(addGroupsCap uint, addSizeCap uint) *DeferredHandler {
+	newh := &DeferredHandler{
+		core:   h.core,
+		groups: make([]group, len(h.groups), len(h.groups)+int(addGroupsCap)),
+	}
+
+	lastID := len(h.groups) - 1
+	for i, g := range h.groups {
+		capValue := len(g.attrs)
+		if lastID == i {
+			capValue += int(addSizeCap)
+		}
+		newh.groups[i] = group{
+			name:  g.name,
+			attrs: make([]slog.Attr, len(g.attrs), capValue),
+		}
+
+		copy(newh.groups[i].attrs, g.attrs)
+	}
+
+	return newh
+}
+
+// Flush replays every buffered record into target, reapplying the
+// WithAttrs/WithGroup chain each record was produced with, and then empties
+// the buffer. Records target.Enabled rejects are skipped rather than
+// forwarded. Replay stops and returns the first error target.Handle returns;
+// any records not yet replayed stay buffered.
+func (h *DeferredHandler) Flush(target slog.Handler) error {
+	h.core.mu.Lock()
+	records := h.core.records
+	h.core.records = nil
+	h.core.mu.Unlock()
+
+	for i, rec := range records {
+		dest := target
+
+		if len(rec.groups[0].attrs) > 0 {
+			dest = dest.WithAttrs(rec.groups[0].attrs)
+		}
+
+		for _, g := range rec.groups[1:] {
+			dest = dest.WithGroup(g.name)
+			if len(g.attrs) > 0 {
+				dest = dest.WithAttrs(g.attrs)
+			}
+		}
+
+		if !dest.Enabled(rec.ctx, rec.record.Level) {
+			continue
+		}
+
+		if err := dest.Handle(rec.ctx, rec.record); err != nil {
+			h.core.mu.Lock()
+			h.core.records = append(records[i:], h.core.records...)
+			h.core.mu.Unlock()
+
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package xslog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestDeferredHandlerFlush(t *testing.T) {
+	handler := NewDeferredHandler(0)
+	log := slog.New(handler)
+
+	log.
+		With(slog.Int("id", 1)).
+		WithGroup("bro").
+		With(slog.Int("bro_id", 2)).
+		Warn("run", slog.String("who", "forest"))
+
+	var buf bytes.Buffer
+	target := NewZerologHandler(zerolog.New(&buf), &HandlerOptions{SkipTime: true})
+
+	if err := handler.Flush(target); err != nil {
+		t.Fatalf("Flush returned error: %v", err)
+	}
+
+	const want = `{"level":"warn","id":1,"bro":{"bro_id":2,"who":"forest"},"message":"run"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected output\nwant: %s\ngot:  %s", want, got)
+	}
+}
+
+func TestDeferredHandlerDropOldest(t *testing.T) {
+	handler := NewDeferredHandler(2)
+	log := slog.New(handler)
+
+	log.Info("first")
+	log.Info("second")
+	log.Info("third")
+
+	var buf bytes.Buffer
+	target := NewZerologHandler(zerolog.New(&buf), &HandlerOptions{SkipTime: true})
+
+	if err := handler.Flush(target); err != nil {
+		t.Fatalf("Flush returned error: %v", err)
+	}
+
+	const want = `{"level":"info","message":"second"}` + "\n" +
+		`{"level":"info","message":"third"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected output after drop-oldest\nwant: %s\ngot:  %s", want, got)
+	}
+}
+
+func TestDeferredHandlerConcurrentHandle(t *testing.T) {
+	handler := NewDeferredHandler(1000)
+	log := slog.New(handler)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.InfoContext(context.Background(), "concurrent")
+		}()
+	}
+	wg.Wait()
+
+	var buf bytes.Buffer
+	target := NewZerologHandler(zerolog.New(&buf), nil)
+	if err := handler.Flush(target); err != nil {
+		t.Fatalf("Flush returned error: %v", err)
+	}
+
+	if got := len(handler.core.records); got != 0 {
+		t.Errorf("expected buffer to be drained, got %d leftover records", got)
+	}
+}
@@ -1,9 +1,10 @@
-package xlog
+package xslog
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"log/slog"
+	"runtime"
 
 	"github.com/ferux/collections"
 	"github.com/rs/zerolog"
@@ -11,10 +12,63 @@ import (
 
 var _ slog.Handler = (*ZerologHandler)(nil)
 
+// noCtxLogger is the sentinel zerolog.Ctx returns when a context carries no
+// attached zerolog.Logger, used to detect whether a caller has stashed one
+// via zerolog.Logger.WithContext.
+var noCtxLogger = zerolog.Ctx(context.Background())
+
 // HandlerOptions allowes to adjust behaviour of the zerolog handler.
 type HandlerOptions struct {
 	// Does not print timestamp even if it set by slog.
 	SkipTime bool
+
+	// Level reports the minimum record level that will be logged.
+	// When set, it takes precedence over the level configured on the
+	// wrapped zerolog.Logger: Handle disables that logger's own minimum
+	// level so it cannot reject a record Enabled already accepted. This
+	// lets callers share a single slog.LevelVar across handlers and flip
+	// verbosity at runtime. A global zerolog.SetGlobalLevel or a Sampler
+	// on the wrapped logger still apply regardless of Level.
+	// If nil, Enabled falls back to asking the wrapped zerolog.Logger.
+	Level slog.Leveler
+
+	// LevelMapper translates a slog.Level into the zerolog.Level used to
+	// build the event. It is also consulted by Enabled when Level is nil,
+	// so Enabled and Handle agree on what is loggable. Defaults to
+	// DefaultLevelMapper, which covers slog's four canonical levels.
+	LevelMapper func(slog.Level) zerolog.Level
+
+	// AddSource causes the handler to resolve record.PC into a "source"
+	// attribute holding "file:line:function", mirroring
+	// slog.HandlerOptions.AddSource.
+	AddSource bool
+
+	// ReplaceAttr, if non-nil, is called for every non-group Attr before it
+	// is written, mirroring slog.HandlerOptions.ReplaceAttr. groups holds
+	// the names of the enclosing groups, outermost first, whether they came
+	// from WithGroup or an ad hoc slog.Group. The built-in time, message
+	// and source attrs are passed with a nil groups slice; level is not
+	// passed through ReplaceAttr, since the wrapped zerolog.Logger writes
+	// it into the event before Handle gets a chance to intercept it.
+	// Returning a zero Attr drops it.
+	ReplaceAttr func(groups []string, a slog.Attr) slog.Attr
+}
+
+// DefaultLevelMapper maps slog's four canonical levels to their zerolog
+// equivalents. Any other level, including custom or offset levels such as
+// slog.LevelInfo+2, is rounded down to the nearest canonical level below it;
+// levels below slog.LevelDebug map to zerolog.DebugLevel.
+func DefaultLevelMapper(level slog.Level) zerolog.Level {
+	switch {
+	case level < slog.LevelInfo:
+		return zerolog.DebugLevel
+	case level < slog.LevelWarn:
+		return zerolog.InfoLevel
+	case level < slog.LevelError:
+		return zerolog.WarnLevel
+	default:
+		return zerolog.ErrorLevel
+	}
 }
 
 // NewZerologHandler creates a wraper over Zerolog to be used as slog.Handler.
@@ -24,6 +78,10 @@ func NewZerologHandler(log zerolog.Logger, opts *HandlerOptions) *ZerologHandler
 	}
 
 	copied := *opts
+	if copied.LevelMapper == nil {
+		copied.LevelMapper = DefaultLevelMapper
+	}
+
 	return &ZerologHandler{
 		log:    log,
 		groups: make([]group, 1),
@@ -53,21 +111,12 @@ type ZerologHandler struct {
 // to make a decision.
 //
 //	Enabled implements slog.Handler interface.
-func (h *ZerologHandler) Enabled(ctx context.Context, level slog.Level) (enabled bool) {
-	switch level {
-	case slog.LevelDebug:
-		enabled = h.log.Debug().Enabled()
-	case slog.LevelInfo:
-		enabled = h.log.Info().Enabled()
-	case slog.LevelWarn:
-		enabled = h.log.Warn().Enabled()
-	case slog.LevelError:
-		enabled = h.log.Error().Enabled()
-	default:
-
+func (h *ZerologHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.opts.Level != nil {
+		return level >= h.opts.Level.Level()
 	}
 
-	return enabled
+	return h.log.WithLevel(h.opts.LevelMapper(level)).Enabled()
 }
 
 // Handle handles the Record.
@@ -98,87 +147,109 @@ func (h *ZerologHandler) Enabled(ctx context.Context, level slog.Level) (enabled
 //
 //	Handle implements slog.Handler interface.
 func (h *ZerologHandler) Handle(ctx context.Context, record slog.Record) error {
-	var event *zerolog.Event
-	switch record.Level {
-	case slog.LevelDebug:
-		event = h.log.Debug()
-	case slog.LevelInfo:
-		event = h.log.Info()
-	case slog.LevelWarn:
-		event = h.log.Warn()
-	case slog.LevelError:
-		event = h.log.Error()
-	default:
-		return errors.New("unsupported log level " + record.Level.String())
+	log := h.log
+	if ctxLogger := zerolog.Ctx(ctx); ctxLogger != noCtxLogger {
+		log = *ctxLogger
+	}
+
+	if h.opts.Level != nil {
+		// Enabled already approved this record against opts.Level; drop the
+		// wrapped zerolog.Logger's own minimum level so it can't silently
+		// re-reject what Enabled just accepted.
+		log = log.Level(zerolog.TraceLevel)
 	}
 
+	event := log.WithLevel(h.opts.LevelMapper(record.Level))
 	if !event.Enabled() {
 		return nil
 	}
 
+	event = event.Ctx(ctx)
+
 	if !h.opts.SkipTime && !record.Time.IsZero() {
-		event = event.Time(zerolog.TimestampFieldName, record.Time.UTC())
+		timeAttr := slog.Time(zerolog.TimestampFieldName, record.Time.UTC())
+		event, _ = appendAttrToEvent(nil, timeAttr, event, h.opts.ReplaceAttr)
 	}
 
-	if record.PC != 0 {
-		event = event.CallerSkipFrame(int(record.PC))
+	if h.opts.AddSource && record.PC != 0 {
+		event, _ = appendAttrToEvent(nil, sourceAttr(record.PC), event, h.opts.ReplaceAttr)
 	}
 
-	var prev *zerolog.Event
-	var prevName string
+	var nested *zerolog.Event
+	var nestedName string
 
 	lastIDx := len(h.groups) - 1
 	for i := lastIDx; i >= 0; i-- {
 		current := h.groups[i]
-		if current.name == "" {
-			collections.ForEach(current.attrs, func(a slog.Attr) {
-				event = appendAttrToEvent(a, event)
+		groupPath := groupPathFor(h.groups, i)
+
+		// A group with an empty name (only ever true for the handler's
+		// root group, at index 0) inlines its Attrs into its parent
+		// instead of nesting under a Dict.
+		target := event
+		if current.name != "" {
+			target = zerolog.Dict()
+		}
+
+		wrote := false
+		for _, attr := range current.attrs {
+			var ok bool
+			target, ok = appendAttrToEvent(groupPath, attr, target, h.opts.ReplaceAttr)
+			wrote = wrote || ok
+		}
+
+		if i == lastIDx {
+			record.Attrs(func(attr slog.Attr) bool {
+				var ok bool
+				target, ok = appendAttrToEvent(groupPath, attr, target, h.opts.ReplaceAttr)
+				wrote = wrote || ok
+				return true
 			})
-			if i == lastIDx {
-				record.Attrs(func(attr slog.Attr) bool {
-					event = appendAttrToEvent(attr, event)
-					return true
-				})
-			}
+		}
 
+		if current.name == "" {
+			// Context-stashed fields always surface as top-level fields,
+			// regardless of how many groups are active, matching
+			// WithSlogFields' "visible to upper callers" contract.
 			store := slogFieldsFromContext(ctx)
-			if store != nil && len(store.fields) > 0 {
+			if store != nil {
 				collections.ForEach(store.fields, func(a slog.Attr) {
-					event = appendAttrToEvent(a, event)
+					target, _ = appendAttrToEvent(nil, a, target, h.opts.ReplaceAttr)
 				})
 			}
 
+			event = target
+			if nested != nil {
+				event.Dict(nestedName, nested)
+			}
+
 			break
 		}
 
-		groupAttrs := zerolog.Dict()
-		collections.ForEach(current.attrs, func(attr slog.Attr) {
-			groupAttrs = appendAttrToEvent(attr, groupAttrs)
-		})
-
-		if i == lastIDx {
-			record.Attrs(func(attr slog.Attr) bool {
-				groupAttrs = appendAttrToEvent(attr, groupAttrs)
-				return true
-			})
+		if nested != nil {
+			target.Dict(nestedName, nested)
+			wrote = true
 		}
 
-		if prev != nil {
-			groupAttrs.Dict(prevName, prev)
+		if wrote {
+			nested = target
+			nestedName = current.name
+		} else {
+			nested = nil
 		}
-
-		prevName = current.name
-		prev = groupAttrs
-	}
-
-	if prev != nil && prevName != "" {
-		event.Dict(prevName, prev)
 	}
 
-	if record.Message == "" {
+	switch {
+	case record.Message == "":
 		event.Send()
-	} else {
+	case h.opts.ReplaceAttr == nil:
+		// No ReplaceAttr configured: let zerolog write the message field
+		// itself, same as before, so its Hooks still see the raw message.
 		event.Msg(record.Message)
+	default:
+		msgAttr := slog.String(zerolog.MessageFieldName, record.Message)
+		event, _ = appendAttrToEvent(nil, msgAttr, event, h.opts.ReplaceAttr)
+		event.Send()
 	}
 
 	return nil
@@ -232,6 +303,32 @@ func (h *ZerologHandler) WithGroup(name string) slog.Handler {
 	return newh
 }
 
+// groupPathFor returns the names of groups[1:i+1], outermost first, for use
+// as the ReplaceAttr group path when processing the attrs of groups[i].
+// Index 0 is always the unnamed root group, so it reports nil for it.
+func groupPathFor(groups []group, i int) []string {
+	if i == 0 {
+		return nil
+	}
+
+	path := make([]string, i)
+	for k := 1; k <= i; k++ {
+		path[k-1] = groups[k].name
+	}
+
+	return path
+}
+
+// sourceAttr resolves pc into a "source" Attr holding "file:line:function".
+func sourceAttr(pc uintptr) slog.Attr {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	if frame.File == "" {
+		return slog.Attr{}
+	}
+
+	return slog.String("source", fmt.Sprintf("%s:%d:%s", frame.File, frame.Line, frame.Function))
+}
+
 func (h *ZerologHandler) clone(addGroupsCap uint, addSizeCap uint) *ZerologHandler {
 	newh := &ZerologHandler{
 		log:    h.log,
@@ -256,45 +353,83 @@ func (h *ZerologHandler) clone(addGroupsCap uint, addSizeCap uint) *ZerologHandl
 	return newh
 }
 
-func appendAttrToEvent(attr slog.Attr, event *zerolog.Event) *zerolog.Event {
+// appendAttrToEvent writes attr onto event and reports whether it wrote
+// anything. An empty Attr (zero key and value) is ignored, as is a group
+// with no Attrs; a group with an empty key has its Attrs inlined into event
+// instead of being nested under a Dict, per the slog.Handler contract.
+//
+// groups is the active group path, used only to call replaceAttr; it is
+// extended with a group's key when recursing into its Attrs, whether the
+// group came from WithGroup or an ad hoc slog.Group. replaceAttr, if
+// non-nil, is applied to every non-group Attr, mirroring
+// slog.HandlerOptions.ReplaceAttr.
+func appendAttrToEvent(groups []string, attr slog.Attr, event *zerolog.Event, replaceAttr func([]string, slog.Attr) slog.Attr) (*zerolog.Event, bool) {
+	// Resolve repeatedly calls LogValue until the result is no longer a
+	// LogValuer, guarding against a value that returns itself by giving up
+	// after a bounded number of calls and returning an error Attr instead.
+	attr.Value = attr.Value.Resolve()
+
+	if replaceAttr != nil && attr.Value.Kind() != slog.KindGroup {
+		attr = replaceAttr(groups, attr)
+	}
+
+	if attr.Equal(slog.Attr{}) {
+		return event, false
+	}
+
 	switch attr.Value.Kind() {
 	case slog.KindGroup:
-		group := attr.Value.Group()
-		dict := zerolog.Dict()
+		groupAttrs := attr.Value.Group()
+		if len(groupAttrs) == 0 {
+			return event, false
+		}
+
+		if attr.Key == "" {
+			wrote := false
+			for _, groupAttr := range groupAttrs {
+				var ok bool
+				event, ok = appendAttrToEvent(groups, groupAttr, event, replaceAttr)
+				wrote = wrote || ok
+			}
 
-		for _, groupAttr := range group {
-			dict = appendAttrToEvent(groupAttr, dict)
+			return event, wrote
 		}
 
-		return event.Dict(attr.Key, dict)
-	case slog.KindLogValuer:
-		v := attr.Value.LogValuer()
-		out := slog.Attr{
-			Key:   attr.Key,
-			Value: v.LogValue(),
+		dict := zerolog.Dict()
+		nestedGroups := append(append([]string(nil), groups...), attr.Key)
+		wrote := false
+		for _, groupAttr := range groupAttrs {
+			var ok bool
+			dict, ok = appendAttrToEvent(nestedGroups, groupAttr, dict, replaceAttr)
+			wrote = wrote || ok
 		}
-		return appendAttrToEvent(out, event)
+
+		if !wrote {
+			return event, false
+		}
+
+		return event.Dict(attr.Key, dict), true
 	case slog.KindBool:
-		return event.Bool(attr.Key, attr.Value.Bool())
+		return event.Bool(attr.Key, attr.Value.Bool()), true
 	case slog.KindInt64:
-		return event.Int64(attr.Key, attr.Value.Int64())
+		return event.Int64(attr.Key, attr.Value.Int64()), true
 	case slog.KindUint64:
-		return event.Uint64(attr.Key, attr.Value.Uint64())
+		return event.Uint64(attr.Key, attr.Value.Uint64()), true
 	case slog.KindFloat64:
-		return event.Float64(attr.Key, attr.Value.Float64())
+		return event.Float64(attr.Key, attr.Value.Float64()), true
 	case slog.KindDuration:
-		return event.Dur(attr.Key, attr.Value.Duration())
+		return event.Dur(attr.Key, attr.Value.Duration()), true
 	case slog.KindTime:
-		return event.Time(attr.Key, attr.Value.Time())
+		return event.Time(attr.Key, attr.Value.Time()), true
 	case slog.KindString:
-		return event.Str(attr.Key, attr.Value.String())
+		return event.Str(attr.Key, attr.Value.String()), true
 	case slog.KindAny:
 		if terr, ok := attr.Value.Any().(error); ok {
-			return event.AnErr(attr.Key, terr)
+			return event.AnErr(attr.Key, terr), true
 		}
 
-		return event.Any(attr.Key, attr.Value.Any())
+		return event.Any(attr.Key, attr.Value.Any()), true
 	default:
-		return event
+		return event, false
 	}
 }
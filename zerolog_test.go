@@ -1,11 +1,17 @@
 package xslog
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"log/slog"
 	"os"
+	"slices"
+	"strings"
 	"testing"
+	"testing/slogtest"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -59,3 +65,241 @@ func TestZerologHandlerEnabled(t *testing.T) {
 		delete(availableLevels, sLevel)
 	}
 }
+
+func TestZerologHandlerEnabled_LevelVar(t *testing.T) {
+	var levelVar slog.LevelVar
+	levelVar.Set(slog.LevelWarn)
+
+	log := zerolog.New(io.Discard).Level(zerolog.DebugLevel)
+	handler := NewZerologHandler(log, &HandlerOptions{Level: &levelVar})
+
+	ctx := context.Background()
+	if handler.Enabled(ctx, slog.LevelInfo) {
+		t.Error("info should be disabled while level var is set to warn")
+	}
+	if !handler.Enabled(ctx, slog.LevelWarn) {
+		t.Error("warn should be enabled while level var is set to warn")
+	}
+
+	levelVar.Set(slog.LevelDebug)
+	if !handler.Enabled(ctx, slog.LevelInfo) {
+		t.Error("info should become enabled after lowering the shared level var")
+	}
+}
+
+func TestZerologHandlerLevelOverridesWrappedLoggerInHandle(t *testing.T) {
+	var levelVar slog.LevelVar
+	levelVar.Set(slog.LevelInfo)
+
+	var buf bytes.Buffer
+	log := zerolog.New(&buf).Level(zerolog.WarnLevel)
+	handler := NewZerologHandler(log, &HandlerOptions{SkipTime: true, Level: &levelVar})
+	slogger := slog.New(handler)
+
+	if !handler.Enabled(context.Background(), slog.LevelInfo) {
+		t.Fatal("Enabled should accept info level per the shared LevelVar")
+	}
+
+	slogger.Info("run")
+
+	const want = `{"level":"info","message":"run"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Handle silently dropped a record Enabled accepted\nwant: %s\ngot:  %s", want, got)
+	}
+}
+
+func TestZerologHandlerCustomLevelMapper(t *testing.T) {
+	const levelTrace = slog.Level(-8)
+
+	log := zerolog.New(io.Discard).Level(zerolog.TraceLevel)
+	handler := NewZerologHandler(log, &HandlerOptions{
+		LevelMapper: func(level slog.Level) zerolog.Level {
+			if level == levelTrace {
+				return zerolog.TraceLevel
+			}
+
+			return DefaultLevelMapper(level)
+		},
+	})
+
+	ctx := context.Background()
+	if !handler.Enabled(ctx, levelTrace) {
+		t.Error("trace level should be enabled via the custom level mapper")
+	}
+}
+
+func TestZerologHandlerSlogtestConformance(t *testing.T) {
+	oldMessageFieldName := zerolog.MessageFieldName
+	zerolog.MessageFieldName = slog.MessageKey
+	defer func() { zerolog.MessageFieldName = oldMessageFieldName }()
+
+	var buf bytes.Buffer
+	handler := NewZerologHandler(zerolog.New(&buf), nil)
+
+	err := slogtest.TestHandler(handler, func() []map[string]any {
+		var results []map[string]any
+		for _, line := range bytes.Split(bytes.TrimRight(buf.Bytes(), "\n"), []byte("\n")) {
+			var m map[string]any
+			if jsonErr := json.Unmarshal(line, &m); jsonErr != nil {
+				t.Fatalf("unmarshal %q: %v", line, jsonErr)
+			}
+			results = append(results, m)
+		}
+		return results
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestZerologHandlerReplaceAttr(t *testing.T) {
+	var buf bytes.Buffer
+
+	handler := NewZerologHandler(zerolog.New(&buf), &HandlerOptions{
+		SkipTime: true,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == "password" {
+				return slog.String("password", "REDACTED")
+			}
+			if len(groups) > 0 && a.Key == "id" {
+				a.Key = groups[len(groups)-1] + "_id"
+			}
+			return a
+		},
+	})
+	log := slog.New(handler)
+
+	log.WithGroup("user").Info("login", slog.String("password", "hunter2"), slog.Int("id", 1))
+
+	const want = `{"level":"info","user":{"password":"REDACTED","user_id":1},"message":"login"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected output\nwant: %s\ngot:  %s", want, got)
+	}
+}
+
+func TestZerologHandlerReplaceAttrRenamesBuiltins(t *testing.T) {
+	var buf bytes.Buffer
+
+	fixedTime := time.Date(2026, 7, 27, 0, 0, 0, 0, time.UTC)
+	handler := NewZerologHandler(zerolog.New(&buf), &HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			switch a.Key {
+			case zerolog.TimestampFieldName:
+				a.Key = "ts"
+			case zerolog.MessageFieldName:
+				a.Key = "msg"
+			}
+			return a
+		},
+	})
+	record := slog.NewRecord(fixedTime, slog.LevelInfo, "run", 0)
+	if err := handler.Handle(context.Background(), record); err != nil {
+		t.Fatalf("Handle returned error: %v", err)
+	}
+
+	const want = `{"level":"info","ts":"2026-07-27T00:00:00Z","msg":"run"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("ReplaceAttr should rename the time and message keys\nwant: %s\ngot:  %s", want, got)
+	}
+}
+
+func TestZerologHandlerReplaceAttrSeesAdHocGroupPath(t *testing.T) {
+	var buf bytes.Buffer
+	var gotGroups []string
+
+	handler := NewZerologHandler(zerolog.New(&buf), &HandlerOptions{
+		SkipTime: true,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == "id" {
+				gotGroups = append([]string(nil), groups...)
+			}
+			return a
+		},
+	})
+	log := slog.New(handler)
+
+	log.Info("msg", slog.Group("req", slog.Int("id", 1)))
+
+	want := []string{"req"}
+	if !slices.Equal(gotGroups, want) {
+		t.Errorf("expected ReplaceAttr to see ad hoc group path %v, got %v", want, gotGroups)
+	}
+}
+
+func TestZerologHandlerAddSource(t *testing.T) {
+	var buf bytes.Buffer
+
+	handler := NewZerologHandler(zerolog.New(&buf), &HandlerOptions{SkipTime: true, AddSource: true})
+	log := slog.New(handler)
+
+	log.Info("run")
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshal output: %v", err)
+	}
+
+	source, ok := got["source"].(string)
+	if !ok || !strings.Contains(source, "zerolog_test.go:") {
+		t.Errorf("expected source to reference zerolog_test.go, got %v", got["source"])
+	}
+}
+
+type selfLogValuer struct{}
+
+func (selfLogValuer) LogValue() slog.Value {
+	return slog.AnyValue(selfLogValuer{})
+}
+
+type nestedLogValuer struct{ depth int }
+
+func (v nestedLogValuer) LogValue() slog.Value {
+	if v.depth == 0 {
+		return slog.StringValue("done")
+	}
+	return slog.AnyValue(nestedLogValuer{depth: v.depth - 1})
+}
+
+func TestZerologHandlerLogValuer(t *testing.T) {
+	var buf bytes.Buffer
+
+	handler := NewZerologHandler(zerolog.New(&buf), &HandlerOptions{SkipTime: true})
+	log := slog.New(handler)
+
+	log.Info("nested", slog.Any("v", nestedLogValuer{depth: 5}))
+
+	const want = `{"level":"info","v":"done","message":"nested"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected output for nested LogValuer\nwant: %s\ngot:  %s", want, got)
+	}
+}
+
+func TestZerologHandlerLogValuerSelfReferenceDoesNotHang(t *testing.T) {
+	var buf bytes.Buffer
+
+	handler := NewZerologHandler(zerolog.New(&buf), &HandlerOptions{SkipTime: true})
+	log := slog.New(handler)
+
+	log.Info("cyclic", slog.Any("v", selfLogValuer{}))
+
+	if !strings.Contains(buf.String(), `"v":"LogValue called too many times`) {
+		t.Errorf("expected a self-referential LogValuer to resolve to an error attr, got: %s", buf.String())
+	}
+}
+
+func TestZerologHandlerContextLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	handler := NewZerologHandler(zerolog.New(io.Discard), &HandlerOptions{SkipTime: true})
+	log := slog.New(handler)
+
+	ctxLogger := zerolog.New(&buf).With().Str("request_id", "abc").Logger()
+	ctx := ctxLogger.WithContext(context.Background())
+
+	log.InfoContext(ctx, "run")
+
+	const want = `{"level":"info","request_id":"abc","message":"run"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected output\nwant: %s\ngot:  %s", want, got)
+	}
+}